@@ -0,0 +1,133 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2015 Romain LÉTENDART
+//
+// See LICENSE file.
+
+// Package config loads core.NetworkConfig definitions from a small, dependency-free
+// configuration format loosely inspired by scfg: one brace-delimited "network <name> { ... }"
+// block per network, with "nick", "server", "sasl-login", "sasl-password", "sasl-mech",
+// "cap <capability>" and "channel <name> [key]" directives inside, e.g.:
+//
+//	network libera {
+//	    nick     mybot
+//	    server   irc.libera.chat:6697
+//	    sasl-login    mybot
+//	    sasl-password hunter2
+//	    channel  "#mychannel"
+//	    channel  "#other" "channelkey"
+//	}
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/romainletendart/goxxx/core"
+)
+
+// Load reads network definitions from path, returning one core.NetworkConfig per "network" block.
+func Load(path string) ([]core.NetworkConfig, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var (
+		networks []core.NetworkConfig
+		current  *core.NetworkConfig
+	)
+
+	scanner := bufio.NewScanner(file)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(line, "network ") && strings.HasSuffix(line, "{"):
+			if current != nil {
+				return nil, fmt.Errorf("%s:%d: nested network blocks are not supported", path, lineNo)
+			}
+			fields := splitFields(line)
+			if len(fields) < 2 {
+				return nil, fmt.Errorf("%s:%d: network block missing a name", path, lineNo)
+			}
+			current = &core.NetworkConfig{Name: unquote(fields[1])}
+
+		case line == "}":
+			if current == nil {
+				return nil, fmt.Errorf("%s:%d: unexpected closing brace", path, lineNo)
+			}
+			networks = append(networks, *current)
+			current = nil
+
+		case current == nil:
+			return nil, fmt.Errorf("%s:%d: directive outside of a network block", path, lineNo)
+
+		default:
+			if err := applyDirective(current, splitFields(line)); err != nil {
+				return nil, fmt.Errorf("%s:%d: %w", path, lineNo, err)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if current != nil {
+		return nil, fmt.Errorf("%s: unterminated network block %q", path, current.Name)
+	}
+	return networks, nil
+}
+
+// applyDirective applies a single directive (fields[0]) with its arguments (fields[1:]) to net.
+func applyDirective(net *core.NetworkConfig, fields []string) error {
+	if len(fields) < 2 {
+		return fmt.Errorf("directive %q is missing its argument", fields[0])
+	}
+	switch fields[0] {
+	case "nick":
+		net.Nick = fields[1]
+	case "server":
+		net.Server = fields[1]
+	case "sasl-login":
+		net.SASLLogin = fields[1]
+	case "sasl-password":
+		net.SASLPassword = fields[1]
+	case "sasl-mech":
+		net.SASLMech = fields[1]
+	case "cap":
+		net.Caps = append(net.Caps, fields[1])
+	case "channel":
+		channel := core.ChannelConfig{Name: fields[1]}
+		if len(fields) >= 3 {
+			channel.Key = fields[2]
+		}
+		net.Channels = append(net.Channels, channel)
+	default:
+		return fmt.Errorf("unknown directive %q", fields[0])
+	}
+	return nil
+}
+
+// splitFields splits a directive/header line into whitespace-separated fields, dropping a
+// trailing "{" and unquoting any double-quoted field.
+func splitFields(line string) []string {
+	line = strings.TrimSpace(strings.TrimSuffix(line, "{"))
+	fields := strings.Fields(line)
+	for i, field := range fields {
+		fields[i] = unquote(field)
+	}
+	return fields
+}
+
+func unquote(field string) string {
+	if len(field) >= 2 && strings.HasPrefix(field, `"`) && strings.HasSuffix(field, `"`) {
+		return field[1 : len(field)-1]
+	}
+	return field
+}
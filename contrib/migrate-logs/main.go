@@ -0,0 +1,65 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2015 Arnaud Vazard
+//
+// See LICENSE file.
+
+// Command migrate-logs walks an fs store.MessageStore log tree and inserts
+// every message into a db store.MessageStore, so deployments started with
+// the fs driver can upgrade to the db driver without losing history.
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"log"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/romainletendart/goxxx/store/db"
+	"github.com/romainletendart/goxxx/store/fs"
+)
+
+func main() {
+	fsDir := flag.String("fs-dir", "", "Directory containing the fs store log files to migrate")
+	dbPath := flag.String("db", "", "Path to the SQLite database to migrate the logs into")
+	flag.Parse()
+
+	if *fsDir == "" || *dbPath == "" {
+		flag.Usage()
+		log.Fatal("-fs-dir and -db are both required")
+	}
+
+	fsStore, err := fs.New(*fsDir)
+	if err != nil {
+		log.Fatalf("Unable to open fs store at %q: %s\n", *fsDir, err)
+	}
+
+	sqlDB, err := sql.Open("sqlite3", *dbPath)
+	if err != nil {
+		log.Fatalf("Unable to open database %q: %s\n", *dbPath, err)
+	}
+	defer sqlDB.Close()
+	dbStore := db.New(sqlDB)
+
+	targets, err := fsStore.Targets()
+	if err != nil {
+		log.Fatalf("Unable to list fs store targets: %s\n", err)
+	}
+
+	var migrated int
+	for _, target := range targets {
+		messages, err := fsStore.MessagesAfter(target.Network, target.Target, time.Time{}, 0)
+		if err != nil {
+			log.Fatalf("Unable to read messages for network %q target %q: %s\n", target.Network, target.Target, err)
+		}
+		for _, message := range messages {
+			if err := dbStore.ImportMessage(message); err != nil {
+				log.Fatalf("Unable to import message %d for network %q target %q: %s\n", message.ID, target.Network, target.Target, err)
+			}
+			migrated++
+		}
+		log.Printf("Migrated %d messages for network %q target %q\n", len(messages), target.Network, target.Target)
+	}
+	log.Printf("Done, migrated %d messages across %d targets\n", migrated, len(targets))
+}
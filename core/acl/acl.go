@@ -0,0 +1,327 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2015 Romain LÉTENDART
+//
+// See LICENSE file.
+
+// Package acl replaces the old "@"-scraped Bot.Admins with a live per-channel
+// role map. It parses full PREFIX/NAMES tokens and MODE changes to track
+// channel status (Owner/Op/HalfOp/Voice), and account identities surfaced by
+// SASL/WHOX/account-notify so authorization survives nick changes. It also
+// persists account grants (e.g. "bot owner for this account") in the SQLite
+// database so they survive restarts.
+package acl
+
+import (
+	"database/sql"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/romainletendart/goxxx/core"
+	"github.com/thoj/go-ircevent"
+)
+
+// ACL tracks authorization state for a Bot: channel roles derived from NAMES/MODE,
+// account identities, and persisted account grants. It implements core.Authorizer.
+type ACL struct {
+	db        *sql.DB
+	mutex     sync.RWMutex
+	prefixes  prefixTable
+	chanModes chanModes
+	channels  map[string]map[string]core.Role // channel -> nick -> role, from NAMES/MODE
+	accounts  map[string]string               // nick -> account, from WHOX/account-notify
+	grants    map[string]core.Role            // account -> persisted role, from "!acl grant"
+}
+
+// instance is the ACL used by the package-level Handle*Cmd functions below, set by Init.
+var instance *ACL
+
+// Init creates the ACL backed by database, registers it with supervisor so it keeps itself up
+// to date from NAMES/MODE/ACCOUNT events on every network, sets it as supervisor's Authorizer
+// and returns it.
+func Init(supervisor *core.Supervisor, database *sql.DB) *ACL {
+	a := &ACL{
+		db:        database,
+		prefixes:  defaultPrefixTable(),
+		chanModes: defaultChanModes(),
+		channels:  make(map[string]map[string]core.Role),
+		accounts:  make(map[string]string),
+		grants:    make(map[string]core.Role),
+	}
+
+	sqlStmt := `CREATE TABLE IF NOT EXISTS AclGrant (
+	    account TEXT NOT NULL PRIMARY KEY,
+	    role TEXT NOT NULL);`
+	if _, err := database.Exec(sqlStmt); err != nil {
+		log.Fatalf("%q: %s\n", err, sqlStmt)
+	}
+	a.loadGrants()
+
+	supervisor.AddRawHandler("005", a.handleISupport)    // RPL_ISUPPORT, carries the PREFIX token
+	supervisor.AddRawHandler("353", a.handleNames)       // RPL_NAMREPLY
+	supervisor.AddRawHandler("MODE", a.handleMode)       // Channel MODE changes
+	supervisor.AddRawHandler("354", a.handleWhox)        // RPL_WHOSPCRPL (WHOX reply)
+	supervisor.AddRawHandler("ACCOUNT", a.handleAccount) // account-notify
+	supervisor.AddRawHandler("PART", a.handlePart)       // Channel leave
+	supervisor.AddRawHandler("KICK", a.handleKick)       // Forced channel leave
+	supervisor.AddRawHandler("QUIT", a.handleQuit)       // Disconnect, leaves every channel at once
+	supervisor.AddRawHandler("NICK", a.handleNick)       // Nick change
+
+	supervisor.SetAuthorizer(a)
+	core.SetIdentityResolver(a)
+
+	instance = a
+	return a
+}
+
+func (a *ACL) loadGrants() {
+	rows, err := a.db.Query("SELECT account, role FROM AclGrant")
+	if err != nil {
+		log.Fatalf("Unable to load ACL grants: %s\n", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var account, roleName string
+		if err := rows.Scan(&account, &roleName); err != nil {
+			log.Fatalf("Unable to load ACL grants: %s\n", err)
+		}
+		if role, ok := core.ParseRole(roleName); ok {
+			a.grants[account] = role
+		}
+	}
+}
+
+// Grant persists role for account and takes it into account immediately.
+func (a *ACL) Grant(account string, role core.Role) error {
+	sqlStmt := "INSERT INTO AclGrant (account, role) VALUES ($1, $2) ON CONFLICT(account) DO UPDATE SET role = $2"
+	if _, err := a.db.Exec(sqlStmt, account, role.String()); err != nil {
+		return err
+	}
+	a.mutex.Lock()
+	a.grants[account] = role
+	a.mutex.Unlock()
+	return nil
+}
+
+// NotifyAccount records that nick is identified as account (or logged out, if account is "" or
+// "*"). Exported so other IRCv3 plumbing (e.g. a future SASL/CAP layer) can feed it identities.
+func (a *ACL) NotifyAccount(nick, account string) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.accounts[nick] = account
+}
+
+// ResolveAccount implements core.IdentityResolver: it returns the account nick is currently
+// known to be authenticated as (from WHOX/account-notify), or "" if unknown or logged out.
+func (a *ACL) ResolveAccount(nick string) string {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+	if account := a.accounts[nick]; account != "*" {
+		return account
+	}
+	return ""
+}
+
+// HasRole implements core.Authorizer: it reports whether nick currently holds at least the
+// required role on target (a channel role, or Registered/account-granted role otherwise).
+func (a *ACL) HasRole(nick, target string, required core.Role) bool {
+	if required == core.Anyone {
+		return true
+	}
+	return a.effectiveRole(nick, target) >= required
+}
+
+func (a *ACL) effectiveRole(nick, target string) core.Role {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+
+	role := core.Anyone
+	if channelRoles, present := a.channels[target]; present {
+		if r, ok := channelRoles[nick]; ok && r > role {
+			role = r
+		}
+	}
+
+	if account := a.accounts[nick]; account != "" && account != "*" {
+		if role < core.Registered {
+			role = core.Registered
+		}
+		if granted, ok := a.grants[account]; ok && granted > role {
+			role = granted
+		}
+	}
+	return role
+}
+
+// handleISupport reads the PREFIX=(modes)symbols and CHANMODES=A,B,C,D tokens off
+// RPL_ISUPPORT to learn this server's actual status letters/symbols and which other mode
+// letters take a parameter, instead of assuming a hard-coded layout.
+func (a *ACL) handleISupport(event *irc.Event) {
+	for _, token := range event.Arguments {
+		switch {
+		case strings.HasPrefix(token, "PREFIX=("):
+			parts := strings.SplitN(strings.TrimPrefix(token, "PREFIX=("), ")", 2)
+			if len(parts) != 2 {
+				continue
+			}
+			a.mutex.Lock()
+			a.prefixes = newPrefixTable(parts[0], parts[1])
+			a.mutex.Unlock()
+
+		case strings.HasPrefix(token, "CHANMODES="):
+			a.mutex.Lock()
+			a.chanModes = newChanModes(strings.TrimPrefix(token, "CHANMODES="))
+			a.mutex.Unlock()
+		}
+	}
+}
+
+// handleNames rebuilds the role map for a channel from a RPL_NAMREPLY line.
+func (a *ACL) handleNames(event *irc.Event) {
+	if len(event.Arguments) < 3 {
+		return
+	}
+	channel := event.Arguments[2]
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	prefixes := a.prefixes
+	roles := make(map[string]core.Role)
+	for _, token := range strings.Fields(event.Message()) {
+		role, nick := prefixes.split(token)
+		roles[nick] = role
+	}
+	a.channels[channel] = roles
+}
+
+// handleMode keeps the role map for a channel up to date as op/halfop/voice status changes.
+// Non-role modes (+b, +k, +l, ...) don't affect roles, but still consume a target argument
+// per the server's CHANMODES token, so every parameterized letter advances targetIndex whether
+// or not it is role-tracked; otherwise a MODE line mixing the two (e.g. "+b-o mask nick", which
+// real networks send routinely) would misalign the remaining targets.
+func (a *ACL) handleMode(event *irc.Event) {
+	if len(event.Arguments) < 2 || !strings.HasPrefix(event.Arguments[0], "#") {
+		return
+	}
+	channel := event.Arguments[0]
+	modeString := event.Arguments[1]
+	targets := event.Arguments[2:]
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if a.channels[channel] == nil {
+		a.channels[channel] = make(map[string]core.Role)
+	}
+
+	adding, targetIndex := true, 0
+	for _, letter := range modeString {
+		switch letter {
+		case '+':
+			adding = true
+		case '-':
+			adding = false
+		default:
+			role, tracked := a.prefixes.modeRole[byte(letter)]
+			if !tracked && !a.chanModes.takesParam(byte(letter), adding) {
+				continue
+			}
+			if targetIndex >= len(targets) {
+				continue
+			}
+			nick := targets[targetIndex]
+			targetIndex++
+			if !tracked {
+				continue
+			}
+			if adding {
+				if role > a.channels[channel][nick] {
+					a.channels[channel][nick] = role
+				}
+			} else if a.channels[channel][nick] == role {
+				delete(a.channels[channel], nick)
+			}
+		}
+	}
+}
+
+// handleWhox records the account carried by an extended WHO (WHOX) reply requesting the
+// "na" field set (nick, account), the common minimal set used to resolve identities.
+func (a *ACL) handleWhox(event *irc.Event) {
+	if len(event.Arguments) < 3 {
+		return
+	}
+	nick := event.Arguments[len(event.Arguments)-2]
+	account := event.Arguments[len(event.Arguments)-1]
+	a.NotifyAccount(nick, account)
+}
+
+// handleAccount handles the account-notify "ACCOUNT" command, sent whenever a user's
+// identification status changes (account name, or "*" when logged out).
+func (a *ACL) handleAccount(event *irc.Event) {
+	a.NotifyAccount(event.Nick, event.Message())
+}
+
+// handlePart evicts the leaving nick's role for the channel it parted, so a reused nick
+// doesn't later inherit it.
+func (a *ACL) handlePart(event *irc.Event) {
+	if len(event.Arguments) < 1 {
+		return
+	}
+	channel := event.Arguments[0]
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	delete(a.channels[channel], event.Nick)
+}
+
+// handleKick evicts the kicked nick's role for the channel it was removed from.
+func (a *ACL) handleKick(event *irc.Event) {
+	if len(event.Arguments) < 2 {
+		return
+	}
+	channel, nick := event.Arguments[0], event.Arguments[1]
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	delete(a.channels[channel], nick)
+}
+
+// handleQuit evicts the disconnecting nick's role from every channel it was tracked in, and
+// its account, since QUIT carries no channel and the nick leaves all of them at once.
+func (a *ACL) handleQuit(event *irc.Event) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	for _, roles := range a.channels {
+		delete(roles, event.Nick)
+	}
+	delete(a.accounts, event.Nick)
+}
+
+// handleNick moves the renaming nick's roles and account to its new nick, so a nick change
+// doesn't drop a user's status and a reused old nick doesn't inherit it instead.
+func (a *ACL) handleNick(event *irc.Event) {
+	newNick := event.Message()
+	if newNick == "" && len(event.Arguments) > 0 {
+		newNick = event.Arguments[0]
+	}
+	oldNick := event.Nick
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	for _, roles := range a.channels {
+		if role, present := roles[oldNick]; present {
+			delete(roles, oldNick)
+			roles[newNick] = role
+		} else {
+			delete(roles, newNick)
+		}
+	}
+	if account, present := a.accounts[oldNick]; present {
+		delete(a.accounts, oldNick)
+		a.accounts[newNick] = account
+	} else {
+		delete(a.accounts, newNick)
+	}
+}
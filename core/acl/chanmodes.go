@@ -0,0 +1,48 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2015 Romain LÉTENDART
+//
+// See LICENSE file.
+
+package acl
+
+import "strings"
+
+// chanModes classifies a server's non-PREFIX channel mode letters by how many arguments they
+// consume, per the ISUPPORT CHANMODES=A,B,C,D token: type A and B always take a parameter (on
+// both set and unset), type C only takes one when being set, and type D never takes one. Without
+// this, a MODE line mixing an untracked parameterized letter with a role letter (e.g. "+b-o mask
+// nick", which real networks send routinely) misaligns which target belongs to which letter.
+type chanModes struct {
+	typeA, typeB, typeC, typeD string
+}
+
+// defaultChanModes is used until RPL_ISUPPORT's CHANMODES token has been seen, covering the
+// common ban/exception/invite-exception, key, limit and no-parameter letters.
+func defaultChanModes() chanModes {
+	return chanModes{typeA: "beI", typeB: "k", typeC: "l", typeD: "aimnpqrstz"}
+}
+
+// newChanModes builds a chanModes from an ISUPPORT CHANMODES=A,B,C,D token's value (everything
+// after "CHANMODES=").
+func newChanModes(value string) chanModes {
+	parts := strings.SplitN(value, ",", 4)
+	for len(parts) < 4 {
+		parts = append(parts, "")
+	}
+	return chanModes{typeA: parts[0], typeB: parts[1], typeC: parts[2], typeD: parts[3]}
+}
+
+// takesParam reports whether letter consumes a target argument when being set (adding) or unset.
+func (modes chanModes) takesParam(letter byte, adding bool) bool {
+	switch {
+	case strings.IndexByte(modes.typeA, letter) >= 0:
+		return true
+	case strings.IndexByte(modes.typeB, letter) >= 0:
+		return true
+	case strings.IndexByte(modes.typeC, letter) >= 0:
+		return adding
+	default:
+		return false
+	}
+}
@@ -0,0 +1,93 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2015 Romain LÉTENDART
+//
+// See LICENSE file.
+
+package acl
+
+import (
+	"fmt"
+	"github.com/emirozer/go-helpers"
+	"github.com/romainletendart/goxxx/core"
+	"github.com/thoj/go-ircevent"
+	"log"
+	"strings"
+)
+
+// Help messages
+const (
+	HelpOp   = "\t!op <nick> \t\t\t=> Give channel operator status to <nick>"
+	HelpDeop = "\t!deop <nick> \t\t\t=> Remove channel operator status from <nick>"
+	HelpAcl  = "\t!acl grant <account> <role> \t=> Grant <role> (Registered, Voice, HalfOp, Op, Owner) to <account>"
+)
+
+var (
+	opCmd   = []string{"!op"}   // Slice containing the possible op commands
+	deopCmd = []string{"!deop"} // Slice containing the possible deop commands
+	aclCmd  = []string{"!acl"}  // Slice containing the possible acl commands
+)
+
+// HandleOpCmd handles the "!op <nick>" command. Requires the Op role (set RequiredRole
+// accordingly when registering it with core.Supervisor.AddCmdHandler).
+func HandleOpCmd(event *irc.Event, tags core.MessageTags, callback func(*core.ReplyCallbackData)) bool {
+	fields := strings.Fields(event.Message())
+	if len(fields) < 2 || !helpers.StringInSlice(fields[0], opCmd) {
+		return false
+	}
+	channel := core.GetTargetFromEvent(event)
+	event.Connection.SendRawf("MODE %s +o %s", channel, fields[1])
+	if callback != nil {
+		callback(&core.ReplyCallbackData{Message: fmt.Sprintf("Giving operator status to %s", fields[1]), Target: channel, Network: core.GetNetworkFromEvent(event)})
+	}
+	return true
+}
+
+// HandleDeopCmd handles the "!deop <nick>" command. Requires the Op role (set RequiredRole
+// accordingly when registering it with core.Supervisor.AddCmdHandler).
+func HandleDeopCmd(event *irc.Event, tags core.MessageTags, callback func(*core.ReplyCallbackData)) bool {
+	fields := strings.Fields(event.Message())
+	if len(fields) < 2 || !helpers.StringInSlice(fields[0], deopCmd) {
+		return false
+	}
+	channel := core.GetTargetFromEvent(event)
+	event.Connection.SendRawf("MODE %s -o %s", channel, fields[1])
+	if callback != nil {
+		callback(&core.ReplyCallbackData{Message: fmt.Sprintf("Removing operator status from %s", fields[1]), Target: channel, Network: core.GetNetworkFromEvent(event)})
+	}
+	return true
+}
+
+// HandleAclCmd handles the "!acl grant <account> <role>" command, persisting the grant through
+// the ACL created by Init. Requires the Owner role (set RequiredRole accordingly).
+func HandleAclCmd(event *irc.Event, tags core.MessageTags, callback func(*core.ReplyCallbackData)) bool {
+	fields := strings.Fields(event.Message())
+	if len(fields) == 0 || !helpers.StringInSlice(fields[0], aclCmd) {
+		return false
+	}
+	target := core.GetTargetFromEvent(event)
+	network := core.GetNetworkFromEvent(event)
+
+	if len(fields) != 4 || fields[1] != "grant" {
+		callback(&core.ReplyCallbackData{Message: "Usage: !acl grant <account> <role>", Target: target, Network: network})
+		return true
+	}
+	account, roleName := fields[2], fields[3]
+
+	role, ok := core.ParseRole(roleName)
+	if !ok {
+		callback(&core.ReplyCallbackData{Message: fmt.Sprintf("Unknown role %q", roleName), Target: target, Network: network})
+		return true
+	}
+	if instance == nil {
+		callback(&core.ReplyCallbackData{Message: "ACL not initialized", Target: target, Network: network})
+		return true
+	}
+	if err := instance.Grant(account, role); err != nil {
+		log.Printf("Unable to grant role: %s\n", err)
+		callback(&core.ReplyCallbackData{Message: "Error while granting the role", Target: target, Network: network})
+		return true
+	}
+	callback(&core.ReplyCallbackData{Message: fmt.Sprintf("Granted %s to %s", role, account), Target: target, Network: network})
+	return true
+}
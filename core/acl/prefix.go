@@ -0,0 +1,93 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2015 Romain LÉTENDART
+//
+// See LICENSE file.
+
+package acl
+
+import "github.com/romainletendart/goxxx/core"
+
+// prefixTable maps a server's NAMES prefix symbols (e.g. '@') and MODE letters (e.g. 'o')
+// to the core.Role they grant, so status tracking follows the server's actual PREFIX
+// ISUPPORT token rather than a hard-coded layout.
+type prefixTable struct {
+	symbolRole map[byte]core.Role
+	modeRole   map[byte]core.Role
+}
+
+// defaultPrefixTable is used until RPL_ISUPPORT's PREFIX token has been seen, matching the
+// common "(qaohv)~&@%+" layout (owner, admin, op, halfop, voice).
+func defaultPrefixTable() prefixTable {
+	return newPrefixTable("qaohv", "~&@%+")
+}
+
+// wellKnownModeLetters maps the PREFIX mode letters used by virtually every IRCd to the
+// core.Role they grant. Classifying by letter, rather than by position in the token, gets
+// common layouts right regardless of how many tiers the server defines: a 2-tier "(ov)@+"
+// layout (e.g. Libera.Chat) still maps 'o' to Op, where counting positions from the junior
+// end along the full Voice/HalfOp/Op/Owner ladder would misclassify it as HalfOp.
+var wellKnownModeLetters = map[byte]core.Role{
+	'q': core.Owner,
+	'a': core.Owner,
+	'o': core.Op,
+	'h': core.HalfOp,
+	'v': core.Voice,
+}
+
+// newPrefixTable builds a prefixTable from an ISUPPORT PREFIX=(letters)symbols token.
+// goxxx only models four status roles (Owner/Op/HalfOp/Voice), so on a 5-tier server the two
+// most senior statuses (e.g. owner/admin) both map to core.Owner. Letters outside
+// wellKnownModeLetters (a non-standard PREFIX token) fall back to a canonical ladder counted
+// from the junior (last) position, since HalfOp is the tier most often missing.
+func newPrefixTable(letters, symbols string) prefixTable {
+	table := prefixTable{symbolRole: make(map[byte]core.Role), modeRole: make(map[byte]core.Role)}
+
+	n := len(symbols)
+	for i := 0; i < n; i++ {
+		role := core.Anyone
+		if i < len(letters) {
+			role = wellKnownModeLetters[letters[i]]
+		}
+		if role == core.Anyone {
+			role = fallbackRole(n - 1 - i)
+		}
+		table.symbolRole[symbols[i]] = role
+		if i < len(letters) {
+			table.modeRole[letters[i]] = role
+		}
+	}
+	return table
+}
+
+// fallbackRole returns the role for a tier fromEnd positions senior to the most junior
+// (last) tier, used for PREFIX letters not in wellKnownModeLetters: Voice, then Op, then
+// Owner for every more senior tier. HalfOp is never assigned by this fallback.
+func fallbackRole(fromEnd int) core.Role {
+	switch fromEnd {
+	case 0:
+		return core.Voice
+	case 1:
+		return core.Op
+	default:
+		return core.Owner
+	}
+}
+
+// split strips the leading status symbols off a NAMES token, returning the highest role they
+// grant (core.Anyone if the token carries none) and the bare nick.
+func (table prefixTable) split(token string) (core.Role, string) {
+	role := core.Anyone
+	i := 0
+	for i < len(token) {
+		r, tracked := table.symbolRole[token[i]]
+		if !tracked {
+			break
+		}
+		if r > role {
+			role = r
+		}
+		i++
+	}
+	return role, token[i:]
+}
@@ -0,0 +1,192 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2015 Romain LÉTENDART
+//
+// See LICENSE file.
+
+package core
+
+import (
+	"expvar"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// floodMetrics exposes goxxx_flood.sent / goxxx_flood.dropped / goxxx_flood.queueDepth on the
+// process's "/debug/vars" expvar endpoint, whenever something serves http.DefaultServeMux.
+var floodMetrics = expvar.NewMap("goxxx_flood")
+
+func init() {
+	floodMetrics.Set("queueDepth", expvar.Func(func() interface{} {
+		allNetworksMutex.Lock()
+		defer allNetworksMutex.Unlock()
+		depth := 0
+		for _, network := range allNetworks {
+			depth += len(network.outbox)
+		}
+		return depth
+	}))
+}
+
+// allNetworks lists every Network created so far, purely so queueDepth above can sum their
+// outboxes; Networks never get removed from it (matching the rest of goxxx's "no teardown"
+// singleton-ish package-level state, e.g. memo/logs/acl's Init).
+var (
+	allNetworksMutex sync.Mutex
+	allNetworks      []*Network
+)
+
+const (
+	outboxSize = 256
+
+	// maxIRCLineBytes is RFC 1459's hard per-line limit, CRLF included.
+	maxIRCLineBytes = 512
+	// estimatedHostmaskBytes is a conservative allowance for "user@host" in the
+	// ":nick!user@host PRIVMSG target :" prefix a server prepends before relaying our own
+	// PRIVMSG back to other clients: we only learn our actual hostmask, if at all, well after
+	// connecting, so budget for a long one rather than track it.
+	estimatedHostmaskBytes = 80
+
+	defaultTargetPeriod  = 1500 * time.Millisecond // ~1 msg/1.5s per target
+	defaultTargetBurst   = 3
+	defaultNetworkPeriod = 200 * time.Millisecond // ~5 msg/s network-wide
+	defaultNetworkBurst  = 10
+)
+
+// tokenBucket is a classic token bucket: it holds up to max tokens, refilling at refillRate
+// tokens/second, and wait blocks until one is available.
+type tokenBucket struct {
+	mutex      sync.Mutex
+	tokens     float64
+	max        float64
+	refillRate float64 // Tokens per second
+	last       time.Time
+}
+
+func newTokenBucket(period time.Duration, burst int) *tokenBucket {
+	return &tokenBucket{
+		tokens:     float64(burst),
+		max:        float64(burst),
+		refillRate: 1 / period.Seconds(),
+		last:       time.Now(),
+	}
+}
+
+// wait blocks until a token is available and consumes it.
+func (bucket *tokenBucket) wait() {
+	for {
+		bucket.mutex.Lock()
+		now := time.Now()
+		bucket.tokens += now.Sub(bucket.last).Seconds() * bucket.refillRate
+		if bucket.tokens > bucket.max {
+			bucket.tokens = bucket.max
+		}
+		bucket.last = now
+
+		if bucket.tokens >= 1 {
+			bucket.tokens--
+			bucket.mutex.Unlock()
+			return
+		}
+		missing := 1 - bucket.tokens
+		sleepFor := time.Duration(missing / bucket.refillRate * float64(time.Second))
+		bucket.mutex.Unlock()
+		time.Sleep(sleepFor)
+	}
+}
+
+// outboundMessage is one reply queued onto a Network's outbox, already split into IRC-safe lines.
+type outboundMessage struct {
+	target       string
+	lines        []string
+	replyToMsgID string
+	done         chan struct{} // Closed once every line has been sent; nil for fire-and-forget replies
+}
+
+// sendLoop drains network's outbox, rate-limiting both per-target and network-wide. Meant to be
+// run in its own goroutine for the lifetime of the Network.
+func (network *Network) sendLoop() {
+	for msg := range network.outbox {
+		target := network.targetBucket(msg.target)
+		for _, line := range msg.lines {
+			target.wait()
+			network.networkBucket.wait()
+			if msg.replyToMsgID != "" {
+				network.ircConn.SendRawf("@+draft/reply=%s PRIVMSG %s :%s", msg.replyToMsgID, msg.target, line)
+			} else {
+				network.ircConn.Privmsg(msg.target, line)
+			}
+			floodMetrics.Add("sent", 1)
+		}
+		if msg.done != nil {
+			close(msg.done)
+		}
+	}
+}
+
+// targetBucket returns (creating it if necessary) the token bucket rate-limiting messages to target.
+func (network *Network) targetBucket(target string) *tokenBucket {
+	network.targetBucketsMutex.Lock()
+	defer network.targetBucketsMutex.Unlock()
+	bucket, present := network.targetBuckets[target]
+	if !present {
+		bucket = newTokenBucket(defaultTargetPeriod, defaultTargetBurst)
+		network.targetBuckets[target] = bucket
+	}
+	return bucket
+}
+
+// enqueue splits message into IRC-safe lines and queues them for target. If block is false and
+// the outbox is full, the message is dropped (counted in floodMetrics) instead of blocking the
+// caller; done, if non-nil, is closed either way once the message is no longer pending.
+func (network *Network) enqueue(target, message, replyToMsgID string, done chan struct{}, block bool) {
+	msg := outboundMessage{target: target, lines: splitMessage(network, target, message), replyToMsgID: replyToMsgID, done: done}
+	if block {
+		network.outbox <- msg
+		return
+	}
+	select {
+	case network.outbox <- msg:
+	default:
+		floodMetrics.Add("dropped", 1)
+		if done != nil {
+			close(done)
+		}
+	}
+}
+
+// splitMessage breaks message into lines that fit under maxIRCLineBytes once relayed back as a
+// PRIVMSG to target, without splitting a UTF-8 rune across two lines.
+func splitMessage(network *Network, target, message string) []string {
+	message = strings.Replace(message, "\n", " ", -1)
+
+	prefixLen := len(":") + len(network.config.Nick) + len("!") + estimatedHostmaskBytes +
+		len(" PRIVMSG ") + len(target) + len(" :")
+	budget := maxIRCLineBytes - prefixLen - len("\r\n")
+	if budget < 1 {
+		budget = 1
+	}
+
+	if len(message) <= budget {
+		return []string{message}
+	}
+
+	var lines []string
+	for len(message) > budget {
+		cut := budget
+		for cut > 0 && !utf8.RuneStart(message[cut]) {
+			cut--
+		}
+		if cut == 0 {
+			cut = budget
+		}
+		lines = append(lines, message[:cut])
+		message = message[cut:]
+	}
+	if len(message) > 0 {
+		lines = append(lines, message)
+	}
+	return lines
+}
@@ -0,0 +1,37 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2015 Romain LÉTENDART
+//
+// See LICENSE file.
+
+package core
+
+// IdentityResolver resolves a nick to the account it is currently authenticated as, returning
+// "" if unknown or not authenticated. Implemented by core/acl.ACL.
+type IdentityResolver interface {
+	ResolveAccount(nick string) string
+}
+
+// identityResolver is the optional IdentityResolver registered through SetIdentityResolver,
+// mirroring how Supervisor.authorizer is set (e.g. by core/acl.Init), but package-level since
+// modules like memo resolve identities off a bare nick with no Supervisor reference at hand.
+var identityResolver IdentityResolver
+
+// SetIdentityResolver registers resolver as the IdentityResolver consulted by ResolveIdentity.
+func SetIdentityResolver(resolver IdentityResolver) {
+	identityResolver = resolver
+}
+
+// ResolveIdentity returns the account nick is currently authenticated as, if an
+// IdentityResolver has been registered and knows one, falling back to nick otherwise. Modules
+// that key storage by identity (e.g. memo) should call this for every nick they key by,
+// whether it is the caller or a command argument naming another user, so that a nick and its
+// account never end up as two different keys for the same person.
+func ResolveIdentity(nick string) string {
+	if identityResolver != nil {
+		if account := identityResolver.ResolveAccount(nick); account != "" {
+			return account
+		}
+	}
+	return nick
+}
@@ -0,0 +1,85 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2015 Romain LÉTENDART
+//
+// See LICENSE file.
+
+// Package ircv3 requests the IRCv3 capabilities goxxx wants beyond what
+// go-ircevent negotiates on its own.
+//
+// go-ircevent already performs "CAP LS" / SASL ("sasl" cap) / "CAP END" internally
+// (via Connection.UseSASL) before RPL_WELCOME, but it resets RequestCaps to nil at
+// the start of that negotiation and only ever appends "sasl" to it, so there is no
+// public way to fold extra capabilities into that first round. Negotiate instead
+// runs a second, additive round right after RPL_WELCOME for everything else
+// (server-time, message-tags, ...) — IRCv3.2's cap-notify explicitly allows
+// capabilities to be (re)negotiated after registration.
+package ircv3
+
+import (
+	"log"
+	"strings"
+
+	"github.com/thoj/go-ircevent"
+)
+
+// DefaultCaps is requested by Negotiate when caps is empty.
+var DefaultCaps = []string{
+	"server-time",
+	"message-tags",
+	"account-tag",
+	"account-notify",
+	"extended-join",
+	"chghost",
+	"away-notify",
+	"batch",
+	"echo-message",
+	"labeled-response",
+	"multi-prefix",
+}
+
+// Negotiate arranges for conn to, as soon as registration completes, send "CAP LS 302" and
+// then CAP REQ only the capabilities from caps (or DefaultCaps, if caps is empty) that the
+// server actually advertised in its CAP LS reply — one CAP REQ per capability, so a server
+// NAKing one capability it doesn't support can't sink every other capability in the same
+// request the way one combined "CAP REQ cap1 cap2 ..." would (a CAP REQ listing several
+// capabilities is all-or-nothing).
+func Negotiate(conn *irc.Connection, caps []string) {
+	if len(caps) == 0 {
+		caps = DefaultCaps
+	}
+	wanted := make(map[string]bool, len(caps))
+	for _, name := range caps {
+		wanted[name] = true
+	}
+
+	conn.AddCallback("001", func(event *irc.Event) {
+		var lsReplies []string
+		var handle int
+		handle = conn.AddCallback("CAP", func(event *irc.Event) {
+			if len(event.Arguments) < 3 {
+				return
+			}
+			switch event.Arguments[1] {
+			case "LS":
+				// A CAP LS reply that doesn't fit on one line is split across several, every
+				// one but the last marked with a "*" continuation argument before the list.
+				lsReplies = append(lsReplies, event.Arguments[len(event.Arguments)-1])
+				if event.Arguments[2] == "*" {
+					return
+				}
+				conn.RemoveCallback("CAP", handle)
+				for _, name := range strings.Fields(strings.Join(lsReplies, " ")) {
+					// CAP LS 302 may suffix a capability with "=value" metadata we don't use.
+					name = strings.SplitN(name, "=", 2)[0]
+					if wanted[name] {
+						conn.SendRawf("CAP REQ :%s", name)
+					}
+				}
+			case "NAK":
+				log.Printf("Server rejected IRCv3 capabilities: %s\n", strings.TrimSpace(event.Arguments[len(event.Arguments)-1]))
+			}
+		})
+		conn.SendRawf("CAP LS 302")
+	})
+}
@@ -0,0 +1,186 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2015 Romain LÉTENDART
+//
+// See LICENSE file.
+
+package core
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/romainletendart/goxxx/core/ircv3"
+	"github.com/thoj/go-ircevent"
+)
+
+// ChannelConfig is a channel a Network joins on connect, with its optional key.
+type ChannelConfig struct {
+	Name string
+	Key  string
+}
+
+// NetworkConfig describes one IRC network a Supervisor connects to. Name identifies the
+// network across the process (used to key ReplyCallbackData.Network and memo rows), and need
+// not match Server.
+type NetworkConfig struct {
+	Name     string
+	Nick     string
+	Server   string
+	Channels []ChannelConfig
+
+	Caps         []string // IRCv3 capabilities to request on top of what go-ircevent negotiates on its own, default ircv3.DefaultCaps
+	SASLLogin    string   // Account to SASL-authenticate as; SASL is only attempted when SASLLogin is non-empty
+	SASLPassword string
+	SASLMech     string // Defaults to "PLAIN" (go-ircevent's own default) when SASLLogin is set and SASLMech is empty
+}
+
+const (
+	initialReconnectBackoff = 2 * time.Second
+	maxReconnectBackoff     = 5 * time.Minute
+)
+
+// Network owns a single IRC connection (and its reconnect state) within a Supervisor.
+type Network struct {
+	config     NetworkConfig
+	supervisor *Supervisor
+	ircConn    *irc.Connection
+	quit       chan struct{}
+
+	outbox             chan outboundMessage // Outbound replies, drained by sendLoop
+	networkBucket      *tokenBucket         // Rate-limits the network as a whole
+	targetBucketsMutex sync.Mutex
+	targetBuckets      map[string]*tokenBucket // Rate-limits each target individually, lazily created
+}
+
+// Name returns the network's identifier, as set in its NetworkConfig.
+func (network *Network) Name() string {
+	return network.config.Name
+}
+
+func newNetwork(supervisor *Supervisor, config NetworkConfig) *Network {
+	network := &Network{
+		config:        config,
+		supervisor:    supervisor,
+		quit:          make(chan struct{}),
+		outbox:        make(chan outboundMessage, outboxSize),
+		networkBucket: newTokenBucket(defaultNetworkPeriod, defaultNetworkBurst),
+		targetBuckets: make(map[string]*tokenBucket),
+	}
+	go network.sendLoop()
+
+	allNetworksMutex.Lock()
+	allNetworks = append(allNetworks, network)
+	allNetworksMutex.Unlock()
+
+	network.ircConn = irc.IRC(config.Nick, config.Nick)
+	network.ircConn.UseTLS = true
+
+	connNetworkNamesMutex.Lock()
+	connNetworkNames[network.ircConn] = config.Name
+	connNetworkNamesMutex.Unlock()
+
+	if config.SASLLogin != "" {
+		network.ircConn.UseSASL = true
+		network.ircConn.SASLLogin = config.SASLLogin
+		network.ircConn.SASLPassword = config.SASLPassword
+		network.ircConn.SASLMech = config.SASLMech
+	}
+
+	ircv3.Negotiate(network.ircConn, config.Caps)
+
+	network.ircConn.AddCallback("PRIVMSG", func(event *irc.Event) {
+		supervisor.mainHandler(network, event)
+	})
+	network.ircConn.AddCallback("001", func(event *irc.Event) {
+		for _, channel := range config.Channels {
+			go network.ircConn.Join(channel.Name + " " + channel.Key)
+		}
+	})
+
+	return network
+}
+
+// connect dials the network and runs its reconnect-with-backoff loop until stopped. Meant to be
+// run in its own goroutine; returns once the network has been explicitly stopped.
+//
+// go-ircevent has no "DISCONNECTED" callback to hook (unlike some other IRC libraries); instead
+// we drive our own loop off ErrorChan(), logging every disconnect/retry through
+// Supervisor.logReconnect in its place.
+func (network *Network) connect() {
+	backoff := initialReconnectBackoff
+	for {
+		select {
+		case <-network.quit:
+			return
+		default:
+		}
+
+		if err := network.ircConn.Connect(network.config.Server); err != nil {
+			network.supervisor.logReconnect(network, err, backoff)
+			if !network.sleep(backoff) {
+				return
+			}
+			backoff = nextBackoff(backoff)
+			continue
+		}
+		backoff = initialReconnectBackoff
+
+		select {
+		case <-network.quit:
+			return
+		case err := <-network.ircConn.ErrorChan():
+			network.supervisor.logReconnect(network, err, backoff)
+			if !network.sleep(backoff) {
+				return
+			}
+			backoff = nextBackoff(backoff)
+		}
+	}
+}
+
+// sleep waits for d (jittered), returning false early if the network is stopped meanwhile.
+func (network *Network) sleep(d time.Duration) bool {
+	select {
+	case <-time.After(jitter(d)):
+		return true
+	case <-network.quit:
+		return false
+	}
+}
+
+// stop closes network's quit channel and disconnects it, unblocking connect.
+func (network *Network) stop() {
+	close(network.quit)
+	network.ircConn.Quit()
+}
+
+func nextBackoff(current time.Duration) time.Duration {
+	next := current * 2
+	if next > maxReconnectBackoff {
+		next = maxReconnectBackoff
+	}
+	return next
+}
+
+// jitter returns d plus or minus 20%, so that many networks reconnecting at once do not all
+// retry in lockstep.
+func jitter(d time.Duration) time.Duration {
+	delta := float64(d) * 0.2
+	return d + time.Duration(delta*(2*rand.Float64()-1))
+}
+
+// reply queues message for target on this network and returns immediately; sendLoop paces
+// delivery against the per-target and network-wide flood-control token buckets, dropping it
+// (see floodMetrics) if the outbox is full.
+func (network *Network) reply(target, message, replyToMsgID string) {
+	network.enqueue(target, message, replyToMsgID, nil, false)
+}
+
+// replyAndWait queues message like reply, but blocks until every line of it has actually been sent.
+func (network *Network) replyAndWait(target, message, replyToMsgID string) {
+	done := make(chan struct{})
+	network.enqueue(target, message, replyToMsgID, done, true)
+	<-done
+}
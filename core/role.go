@@ -0,0 +1,56 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2015 Romain LÉTENDART
+//
+// See LICENSE file.
+
+package core
+
+// Role is the authorization level a Command can require before mainHandler dispatches it.
+// Roles form a ladder (Anyone < Registered < Voice < HalfOp < Op < Owner): a user is
+// authorized for a required role if their own role is at least as high.
+type Role int
+
+// The roles a Command can require, from least to most privileged.
+const (
+	Anyone     Role = iota // No restriction, the default zero value
+	Registered             // Identified with services (SASL/WHOX/account-notify), regardless of channel status
+	Voice
+	HalfOp
+	Op
+	Owner
+)
+
+var roleNames = map[Role]string{
+	Anyone:     "Anyone",
+	Registered: "Registered",
+	Voice:      "Voice",
+	HalfOp:     "HalfOp",
+	Op:         "Op",
+	Owner:      "Owner",
+}
+
+// String returns the canonical name of role, as accepted by ParseRole.
+func (role Role) String() string {
+	if name, present := roleNames[role]; present {
+		return name
+	}
+	return "Anyone"
+}
+
+// ParseRole parses the canonical name of a role (as produced by Role.String), for
+// example when reading a role back from persisted storage or a command argument.
+func ParseRole(name string) (Role, bool) {
+	for role, roleName := range roleNames {
+		if roleName == name {
+			return role, true
+		}
+	}
+	return Anyone, false
+}
+
+// Authorizer decides whether a user currently holds at least the required Role on target.
+// Implemented by core/acl.ACL and set on a Supervisor with SetAuthorizer.
+type Authorizer interface {
+	HasRole(nick, target string, required Role) bool
+}
@@ -0,0 +1,439 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2015 Romain LÉTENDART
+//
+// See LICENSE file.
+
+// Package core contains the bot's core functionalities
+package core
+
+import (
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/romainletendart/goxxx/store"
+	"github.com/thoj/go-ircevent"
+)
+
+// HandlerHandle is an opaque identifier returned by AddCmdHandler/AddMsgHandler.
+// Keep it to later unregister the handler with RemoveCmdHandler/RemoveMsgHandler.
+type HandlerHandle uint64
+
+// ReplyCallbackData Structure used by the handlers to send data in a standardized format
+type ReplyCallbackData struct {
+	Message      string // Message to send
+	Target       string // Destination target of the message (Channel or Nick)
+	Network      string // Network (see NetworkConfig.Name) to send on; empty selects the Supervisor's only network
+	ReplyToMsgID string // If set, the message is sent tagged "+draft/reply=<ReplyToMsgID>" (requires the message-tags cap)
+}
+
+// Command structure
+type Command struct {
+	Module       string
+	HelpMessage  string
+	Triggers     []string
+	Priority     int           // Handlers with a higher priority are tried first, default 0
+	Once         bool          // If true the handler is removed after it fires once
+	TTL          time.Duration // If non-zero the handler is removed once this duration has elapsed, fired or not
+	RequiredRole Role          // Minimum role the caller must hold for mainHandler to dispatch this command, default Anyone
+	Handler      func(event *irc.Event, tags MessageTags, callback func(*ReplyCallbackData)) bool
+}
+
+// MsgHandler describes a message handler and its registration options, the
+// message equivalent of Command for handlers that do not claim a specific
+// trigger word.
+type MsgHandler struct {
+	Module   string
+	Priority int           // Handlers with a higher priority are tried first, default 0
+	Once     bool          // If true the handler is removed after it fires once
+	TTL      time.Duration // If non-zero the handler is removed once this duration has elapsed, fired or not
+	Handler  func(event *irc.Event, tags MessageTags, callback func(*ReplyCallbackData))
+}
+
+// cmdHandlerEntry is the internal bookkeeping wrapping a registered Command.
+type cmdHandlerEntry struct {
+	handle       HandlerHandle
+	triggers     []string
+	priority     int
+	once         bool
+	deadline     time.Time // Zero value means "no deadline"
+	requiredRole Role
+	handler      func(*irc.Event, MessageTags, func(*ReplyCallbackData)) bool
+	reply        func(*ReplyCallbackData)
+}
+
+func (entry *cmdHandlerEntry) expired(now time.Time) bool {
+	return !entry.deadline.IsZero() && now.After(entry.deadline)
+}
+
+// msgHandlerEntry is the internal bookkeeping wrapping a registered MsgHandler.
+type msgHandlerEntry struct {
+	handle   HandlerHandle
+	priority int
+	once     bool
+	deadline time.Time // Zero value means "no deadline"
+	handler  func(*irc.Event, MessageTags, func(*ReplyCallbackData))
+	reply    func(*ReplyCallbackData)
+}
+
+func (entry *msgHandlerEntry) expired(now time.Time) bool {
+	return !entry.deadline.IsZero() && now.After(entry.deadline)
+}
+
+// rawHandlerEntry is a raw IRC callback registered through AddRawHandler, replayed onto every
+// Network a Supervisor connects (including ones added after the call).
+type rawHandlerEntry struct {
+	command  string
+	callback func(*irc.Event)
+}
+
+// Supervisor owns every Network a bot process serves, plus the command/message handler
+// registry shared across all of them.
+type Supervisor struct {
+	mutex       sync.RWMutex // Protects everything below
+	networks    map[string]*Network
+	nextHandle  HandlerHandle
+	msgHandlers []*msgHandlerEntry
+	cmdHandlers []*cmdHandlerEntry
+	rawHandlers []rawHandlerEntry
+	logStore    store.MessageStore // Optional, set through SetMessageStore; every PRIVMSG is logged there when set
+	authorizer  Authorizer         // Optional, set through SetAuthorizer; decides who may run a Command with a RequiredRole above Anyone
+}
+
+// NewSupervisor creates an empty Supervisor. Add networks to it with AddNetwork.
+func NewSupervisor() *Supervisor {
+	return &Supervisor{networks: make(map[string]*Network)}
+}
+
+// AddNetwork registers a new Network from config and creates its connection. The network starts
+// connecting once Run is called.
+func (supervisor *Supervisor) AddNetwork(config NetworkConfig) *Network {
+	network := newNetwork(supervisor, config)
+
+	supervisor.mutex.Lock()
+	for _, raw := range supervisor.rawHandlers {
+		network.ircConn.AddCallback(raw.command, raw.callback)
+	}
+	supervisor.networks[config.Name] = network
+	supervisor.mutex.Unlock()
+
+	return network
+}
+
+// Network returns the network registered under name, or nil if there is none.
+func (supervisor *Supervisor) Network(name string) *Network {
+	supervisor.mutex.RLock()
+	defer supervisor.mutex.RUnlock()
+	return supervisor.networks[name]
+}
+
+// AddRawHandler registers callback for the raw IRC command (numeric or named, e.g. "353",
+// "MODE", "ACCOUNT") on every network, present and future, letting feature packages such as
+// core/acl observe protocol events that core itself does not interpret.
+func (supervisor *Supervisor) AddRawHandler(command string, callback func(*irc.Event)) {
+	supervisor.mutex.Lock()
+	defer supervisor.mutex.Unlock()
+	supervisor.rawHandlers = append(supervisor.rawHandlers, rawHandlerEntry{command, callback})
+	for _, network := range supervisor.networks {
+		network.ircConn.AddCallback(command, callback)
+	}
+}
+
+// SetAuthorizer sets the Authorizer consulted by mainHandler before dispatching a Command whose
+// RequiredRole is above Anyone. Pass nil to let every command through regardless of RequiredRole.
+func (supervisor *Supervisor) SetAuthorizer(authorizer Authorizer) {
+	supervisor.mutex.Lock()
+	defer supervisor.mutex.Unlock()
+	supervisor.authorizer = authorizer
+}
+
+// SetMessageStore sets the store used to log every PRIVMSG the bot sees (see GetMessageStore).
+// Pass nil to disable channel-log capture.
+func (supervisor *Supervisor) SetMessageStore(s store.MessageStore) {
+	supervisor.mutex.Lock()
+	defer supervisor.mutex.Unlock()
+	supervisor.logStore = s
+}
+
+// GetMessageStore returns the store currently used to log channel messages, or nil if none was set.
+func (supervisor *Supervisor) GetMessageStore() store.MessageStore {
+	supervisor.mutex.RLock()
+	defer supervisor.mutex.RUnlock()
+	return supervisor.logStore
+}
+
+// AddMsgHandler adds a message handler to supervisor and returns a handle that can be passed to RemoveMsgHandler.
+// msgStruct.Handler will be called on every user message the bot reads (if a command was not found previously in the message).
+// replyCallback is to be called by msgStruct.Handler (or not) to yield and process its result as a string message.
+func (supervisor *Supervisor) AddMsgHandler(msgStruct *MsgHandler, replyCallback func(*ReplyCallbackData)) HandlerHandle {
+	if msgStruct.Handler == nil {
+		return 0
+	}
+	entry := &msgHandlerEntry{
+		priority: msgStruct.Priority,
+		once:     msgStruct.Once,
+		handler:  msgStruct.Handler,
+		reply:    replyCallback,
+	}
+	if msgStruct.TTL > 0 {
+		entry.deadline = time.Now().Add(msgStruct.TTL)
+	}
+
+	supervisor.mutex.Lock()
+	defer supervisor.mutex.Unlock()
+	supervisor.nextHandle++
+	entry.handle = supervisor.nextHandle
+	supervisor.msgHandlers = append(supervisor.msgHandlers, entry)
+	sort.SliceStable(supervisor.msgHandlers, func(i, j int) bool {
+		return supervisor.msgHandlers[i].priority > supervisor.msgHandlers[j].priority
+	})
+	return entry.handle
+}
+
+// RemoveMsgHandler unregisters the message handler identified by handle, if still registered.
+func (supervisor *Supervisor) RemoveMsgHandler(handle HandlerHandle) {
+	supervisor.mutex.Lock()
+	defer supervisor.mutex.Unlock()
+	for i, entry := range supervisor.msgHandlers {
+		if entry.handle == handle {
+			supervisor.msgHandlers = append(supervisor.msgHandlers[:i], supervisor.msgHandlers[i+1:]...)
+			return
+		}
+	}
+}
+
+// AddCmdHandler adds a command handler to supervisor and returns a handle that can be passed to RemoveCmdHandler.
+// cmdStruct is a pointer to a Command structure.
+// replyCallback is to be called by cmdStruct.Handler (or not) to yield and process its result as a string message.
+// Command handlers must return true if they found a command to process, false otherwise
+func (supervisor *Supervisor) AddCmdHandler(cmdStruct *Command, replyCallback func(*ReplyCallbackData)) HandlerHandle {
+	if cmdStruct.Handler == nil {
+		return 0
+	}
+	entry := &cmdHandlerEntry{
+		triggers:     cmdStruct.Triggers,
+		priority:     cmdStruct.Priority,
+		once:         cmdStruct.Once,
+		requiredRole: cmdStruct.RequiredRole,
+		handler:      cmdStruct.Handler,
+		reply:        replyCallback,
+	}
+	if cmdStruct.TTL > 0 {
+		entry.deadline = time.Now().Add(cmdStruct.TTL)
+	}
+
+	supervisor.mutex.Lock()
+	defer supervisor.mutex.Unlock()
+	supervisor.nextHandle++
+	entry.handle = supervisor.nextHandle
+	supervisor.cmdHandlers = append(supervisor.cmdHandlers, entry)
+	sort.SliceStable(supervisor.cmdHandlers, func(i, j int) bool {
+		return supervisor.cmdHandlers[i].priority > supervisor.cmdHandlers[j].priority
+	})
+	return entry.handle
+}
+
+// RemoveCmdHandler unregisters the command handler identified by handle, if still registered.
+func (supervisor *Supervisor) RemoveCmdHandler(handle HandlerHandle) {
+	supervisor.mutex.Lock()
+	defer supervisor.mutex.Unlock()
+	for i, entry := range supervisor.cmdHandlers {
+		if entry.handle == handle {
+			supervisor.cmdHandlers = append(supervisor.cmdHandlers[:i], supervisor.cmdHandlers[i+1:]...)
+			return
+		}
+	}
+}
+
+// Run connects every registered network and blocks until all of them have stopped.
+func (supervisor *Supervisor) Run() {
+	supervisor.mutex.RLock()
+	networks := make([]*Network, 0, len(supervisor.networks))
+	for _, network := range supervisor.networks {
+		networks = append(networks, network)
+	}
+	supervisor.mutex.RUnlock()
+
+	var wg sync.WaitGroup
+	for _, network := range networks {
+		wg.Add(1)
+		go func(network *Network) {
+			defer wg.Done()
+			network.connect()
+		}(network)
+	}
+	wg.Wait()
+}
+
+// Stop disconnects every network (details: https://tools.ietf.org/html/rfc1459#section-4.1.6).
+func (supervisor *Supervisor) Stop() {
+	supervisor.mutex.RLock()
+	defer supervisor.mutex.RUnlock()
+	for _, network := range supervisor.networks {
+		network.stop()
+	}
+}
+
+// logReconnect logs a network disconnecting and the backoff before supervisor retries it, in
+// place of the "DISCONNECTED" callback libraries with richer event models expose.
+func (supervisor *Supervisor) logReconnect(network *Network, err error, backoff time.Duration) {
+	log.Printf("[%s] disconnected (%s), retrying in %s\n", network.Name(), err, backoff)
+}
+
+// ReplyToAll sends a message to every channel of data.Network (or the Supervisor's only
+// network, if data.Network is empty).
+func (supervisor *Supervisor) ReplyToAll(data *ReplyCallbackData) {
+	network := supervisor.resolveNetwork(data.Network)
+	if network == nil {
+		return
+	}
+	for _, channel := range network.config.Channels {
+		network.reply(channel.Name, data.Message, data.ReplyToMsgID)
+	}
+}
+
+// Reply queues a message to the user or channel specified by "data.Target" on "data.Network" (or
+// the Supervisor's only network, if data.Network is empty), and returns without waiting for it
+// to actually be sent. Use ReplyAndWait to block until delivery.
+func (supervisor *Supervisor) Reply(data *ReplyCallbackData) {
+	if data.Target == "" {
+		return
+	}
+	network := supervisor.resolveNetwork(data.Network)
+	if network == nil {
+		return
+	}
+	network.reply(data.Target, data.Message, data.ReplyToMsgID)
+}
+
+// ReplyAndWait behaves like Reply, but blocks until the message has actually been sent (i.e.
+// cleared flood control), rather than merely enqueuing it.
+func (supervisor *Supervisor) ReplyAndWait(data *ReplyCallbackData) {
+	if data.Target == "" {
+		return
+	}
+	network := supervisor.resolveNetwork(data.Network)
+	if network == nil {
+		return
+	}
+	network.replyAndWait(data.Target, data.Message, data.ReplyToMsgID)
+}
+
+// resolveNetwork looks up name, falling back to the Supervisor's only network when name is
+// empty and exactly one network is registered.
+func (supervisor *Supervisor) resolveNetwork(name string) *Network {
+	supervisor.mutex.RLock()
+	defer supervisor.mutex.RUnlock()
+	if name != "" {
+		return supervisor.networks[name]
+	}
+	if len(supervisor.networks) == 1 {
+		for _, network := range supervisor.networks {
+			return network
+		}
+	}
+	return nil
+}
+
+// mainHandler is called on every message posted in a channel network is connected to, or
+// directly sent to the bot on network.
+func (supervisor *Supervisor) mainHandler(network *Network, event *irc.Event) {
+
+	if strings.TrimSpace(event.Message()) == "" {
+		return
+	}
+
+	cmd := strings.Fields(event.Message())[0]
+
+	supervisor.mutex.RLock()
+	cmdEntries := make([]*cmdHandlerEntry, len(supervisor.cmdHandlers))
+	copy(cmdEntries, supervisor.cmdHandlers)
+	msgEntries := make([]*msgHandlerEntry, len(supervisor.msgHandlers))
+	copy(msgEntries, supervisor.msgHandlers)
+	logStore := supervisor.logStore
+	authorizer := supervisor.authorizer
+	supervisor.mutex.RUnlock()
+
+	if logStore != nil {
+		target, nick, text := GetTargetFromEvent(event), event.Nick, event.Message()
+		go func() {
+			if err := logStore.LogMessage(network.Name(), target, nick, text); err != nil {
+				log.Printf("Unable to log message: %s\n", err)
+			}
+		}()
+	}
+
+	now := time.Now()
+	tags := ParseMessageTags(event)
+
+	for _, entry := range cmdEntries {
+		if entry.expired(now) {
+			supervisor.RemoveCmdHandler(entry.handle)
+			continue
+		}
+		if !stringInSlice(cmd, entry.triggers) {
+			continue
+		}
+		if authorizer != nil && entry.requiredRole != Anyone && !authorizer.HasRole(event.Nick, GetTargetFromEvent(event), entry.requiredRole) {
+			return
+		}
+		if entry.once {
+			supervisor.RemoveCmdHandler(entry.handle)
+		}
+		go entry.handler(event, tags, entry.reply)
+		return
+	}
+
+	for _, entry := range msgEntries {
+		if entry.expired(now) {
+			supervisor.RemoveMsgHandler(entry.handle)
+			continue
+		}
+		if entry.once {
+			supervisor.RemoveMsgHandler(entry.handle)
+		}
+		go entry.handler(event, tags, entry.reply)
+	}
+}
+
+func stringInSlice(needle string, haystack []string) bool {
+	for _, candidate := range haystack {
+		if candidate == needle {
+			return true
+		}
+	}
+	return false
+}
+
+func GetTargetFromEvent(event *irc.Event) string {
+	source := strings.TrimSpace(event.Arguments[0])
+	if strings.HasPrefix(source, "#") {
+		return source
+	} else {
+		return event.Nick
+	}
+}
+
+// connNetworkNames maps an *irc.Connection to the name of the Network that owns it.
+// go-ircevent's Connection has no user-data field to stash this on directly, and
+// GetNetworkFromEvent needs to work from just an *irc.Event, so newNetwork registers every
+// connection it creates here instead.
+var (
+	connNetworkNamesMutex sync.RWMutex
+	connNetworkNames      = make(map[*irc.Connection]string)
+)
+
+// GetNetworkFromEvent returns the identifier of the Network event was received on (its
+// NetworkConfig.Name), or "" if event carries no connection, or one not created through a
+// Supervisor (e.g. hand-built events in tests).
+func GetNetworkFromEvent(event *irc.Event) string {
+	if event.Connection == nil {
+		return ""
+	}
+	connNetworkNamesMutex.RLock()
+	defer connNetworkNamesMutex.RUnlock()
+	return connNetworkNames[event.Connection]
+}
@@ -0,0 +1,37 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2015 Romain LÉTENDART
+//
+// See LICENSE file.
+
+package core
+
+import (
+	"github.com/thoj/go-ircevent"
+	"time"
+)
+
+// MessageTags holds the subset of IRCv3 message tags goxxx understands, parsed from an
+// event's raw tags (irc.Event.Tags) once message-tags/server-time/account-tag are negotiated
+// (see ircv3.Negotiate). Every field is the zero value when the server did not send the tag.
+type MessageTags struct {
+	Label      string    // draft/label: correlates a reply with the command that triggered it
+	MsgID      string    // msgid: this message's own identifier, if the server assigns one
+	ServerTime time.Time // server-time: when the server processed the message
+	Account    string    // account-tag: the sender's authenticated account, if any
+}
+
+// ParseMessageTags extracts the MessageTags goxxx understands out of event.Tags.
+func ParseMessageTags(event *irc.Event) MessageTags {
+	tags := MessageTags{
+		Label:   event.Tags["draft/label"],
+		MsgID:   event.Tags["msgid"],
+		Account: event.Tags["account"],
+	}
+	if raw, present := event.Tags["time"]; present {
+		if serverTime, err := time.Parse(time.RFC3339Nano, raw); err == nil {
+			tags.ServerTime = serverTime
+		}
+	}
+	return tags
+}
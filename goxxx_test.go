@@ -10,6 +10,7 @@ import (
 	// "github.com/fatih/color"
 	"github.com/romainletendart/goxxx/core"
 	"github.com/romainletendart/goxxx/memo"
+	"github.com/romainletendart/goxxx/store/db"
 	"github.com/thoj/go-ircevent"
 	"regexp"
 	"testing"
@@ -18,7 +19,7 @@ import (
 func TestHandleMemoCmd(t *testing.T) {
 	database := initDatabase("tests.sqlite", true)
 	defer database.Close()
-	memo.Init(database)
+	memo.Init(db.New(database))
 
 	// --- --- --- Supposed to pass
 	var (
@@ -30,10 +31,10 @@ func TestHandleMemoCmd(t *testing.T) {
 			Arguments: []string{"#test_channel", message}}
 
 		replyCallbackDataTest      core.ReplyCallbackData
-		replyCallbackDataReference core.ReplyCallbackData = core.ReplyCallbackData{Nick: "Sender", Message: "Sender: memo for Receiver saved"}
+		replyCallbackDataReference core.ReplyCallbackData = core.ReplyCallbackData{Target: "#test_channel", Message: "Sender: memo for Receiver saved"}
 	)
 
-	memo.HandleMemoCmd(&event, func(data *core.ReplyCallbackData) {
+	memo.HandleMemoCmd(&event, core.MessageTags{}, func(data *core.ReplyCallbackData) {
 		replyCallbackDataTest = *data
 	})
 
@@ -49,7 +50,7 @@ func TestHandleMemoCmd(t *testing.T) {
 		Arguments: []string{"#test_channel", message}}
 
 	// There is no memo command in the message, the callback should not be called
-	memo.HandleMemoCmd(&event, func(data *core.ReplyCallbackData) {
+	memo.HandleMemoCmd(&event, core.MessageTags{}, func(data *core.ReplyCallbackData) {
 		t.Errorf("Callback function not supposed to be called, the message does not contain the !memo command (Message: %q)\n\n", message)
 	})
 	// --- --- --- --- --- ---
@@ -58,7 +59,7 @@ func TestHandleMemoCmd(t *testing.T) {
 func TestSendMemo(t *testing.T) {
 	database := initDatabase("tests.sqlite", true)
 	defer database.Close()
-	memo.Init(database)
+	memo.Init(db.New(database))
 
 	var (
 		message               string    = "!memo Receiver this is a memo"
@@ -68,20 +69,20 @@ func TestSendMemo(t *testing.T) {
 	)
 
 	// Create Memo
-	memo.HandleMemoCmd(&event, nil)
+	memo.HandleMemoCmd(&event, core.MessageTags{}, nil)
 
 	message = " this is a message to trigger the memo "
 	event = irc.Event{Nick: expectedNick, Arguments: []string{"#test_channel", message}}
 	re := regexp.MustCompile(fmt.Sprintf(`^%s: memo from Sender => "this is a memo" \(\d{2}/\d{2}/\d{4} @ \d{2}:\d{2}\)$`, expectedNick))
 
-	memo.SendMemo(&event, func(data *core.ReplyCallbackData) {
+	memo.SendMemo(&event, core.MessageTags{}, func(data *core.ReplyCallbackData) {
 		replyCallbackDataTest = *data
 	})
 
 	if !re.MatchString(replyCallbackDataTest.Message) {
 		t.Errorf("Regexp %q not matching %q", re.String(), replyCallbackDataTest.Message)
 	}
-	if replyCallbackDataTest.Nick != expectedNick {
-		t.Errorf("Incorrect Nick: should be %q, is %q", expectedNick, replyCallbackDataTest.Nick)
+	if replyCallbackDataTest.Target != "#test_channel" {
+		t.Errorf("Incorrect Target: should be %q, is %q", "#test_channel", replyCallbackDataTest.Target)
 	}
 }
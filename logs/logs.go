@@ -0,0 +1,115 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2015 Arnaud Vazard
+//
+// See LICENSE file.
+
+// Package logs exposes channel log search and CHATHISTORY-style range queries
+// over the MessageStore that core.Supervisor feeds every PRIVMSG into.
+package logs
+
+import (
+	"fmt"
+	"github.com/emirozer/go-helpers"
+	"github.com/romainletendart/goxxx/core"
+	"github.com/romainletendart/goxxx/store"
+	"github.com/thoj/go-ircevent"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Help message for the log command
+const HelpLog = "\t!log search <query> \t=> Search the channel history for messages matching <query>\n" +
+	"\t!log before <id> \t=> List the 10 messages sent right before message <id>\n" +
+	"\t!log after <unix-ts> \t=> List the 10 messages sent right after the given Unix timestamp\n" +
+	"\t!log latest [n] \t=> List the n (default 10) most recent messages"
+
+// defaultLimit is used whenever a query does not specify how many messages to return.
+const defaultLimit = 10
+
+var (
+	logCmd       = []string{"!log"} // Slice containing the possible log commands
+	messageStore store.MessageStore // Backing store for channel logs
+)
+
+// Init stores the MessageStore used to search and list channel logs.
+func Init(s store.MessageStore) {
+	messageStore = s
+}
+
+// HandleLogCmd handles the "!log search/before/after/latest" commands.
+func HandleLogCmd(event *irc.Event, tags core.MessageTags, callback func(*core.ReplyCallbackData)) bool {
+	fields := strings.Fields(event.Message())
+	// fields[0] => Command
+	// fields[1] => Sub-command (search, before, after, latest)
+	if len(fields) < 2 || !helpers.StringInSlice(fields[0], logCmd) {
+		return false
+	}
+	target := core.GetTargetFromEvent(event)
+	network := core.GetNetworkFromEvent(event)
+
+	var (
+		messages []store.Message
+		err      error
+	)
+	switch fields[1] {
+	case "search":
+		if len(fields) < 3 {
+			callback(&core.ReplyCallbackData{Message: "Usage: !log search <query>", Target: target, Network: network})
+			return true
+		}
+		messages, err = messageStore.SearchMessages(network, target, strings.Join(fields[2:], " "), defaultLimit)
+
+	case "before":
+		if len(fields) < 3 {
+			callback(&core.ReplyCallbackData{Message: "Usage: !log before <id>", Target: target, Network: network})
+			return true
+		}
+		var msgID int64
+		if msgID, err = strconv.ParseInt(fields[2], 10, 64); err == nil {
+			messages, err = messageStore.MessagesBefore(network, target, msgID, defaultLimit)
+		}
+
+	case "after":
+		if len(fields) < 3 {
+			callback(&core.ReplyCallbackData{Message: "Usage: !log after <unix-ts>", Target: target, Network: network})
+			return true
+		}
+		var unixTS int64
+		if unixTS, err = strconv.ParseInt(fields[2], 10, 64); err == nil {
+			messages, err = messageStore.MessagesAfter(network, target, time.Unix(unixTS, 0), defaultLimit)
+		}
+
+	case "latest":
+		limit := defaultLimit
+		if len(fields) >= 3 {
+			if n, convErr := strconv.Atoi(fields[2]); convErr == nil {
+				limit = n
+			}
+		}
+		messages, err = messageStore.LatestMessages(network, target, limit)
+
+	default:
+		return false
+	}
+
+	if err != nil {
+		log.Printf("Unable to query message log: %s\n", err)
+		callback(&core.ReplyCallbackData{Message: "Error while searching the log", Target: target, Network: network})
+		return true
+	}
+
+	if len(messages) == 0 {
+		callback(&core.ReplyCallbackData{Message: "No matching message found", Target: target, Network: network})
+		return true
+	}
+	for _, message := range messages {
+		callback(&core.ReplyCallbackData{
+			Message: fmt.Sprintf("[%d|%s] %s: %s", message.ID, message.Date.Format("02/01/2006 @ 15:04"), message.Nick, message.Text),
+			Target:  target,
+			Network: network})
+	}
+	return true
+}
@@ -8,11 +8,11 @@
 package memo
 
 import (
-	"database/sql"
 	"fmt"
 	"github.com/emirozer/go-helpers"
+	"github.com/romainletendart/goxxx/core"
+	"github.com/romainletendart/goxxx/store"
 	"github.com/thoj/go-ircevent"
-	"github.com/vaz-ar/goxxx/core"
 	"log"
 	"strings"
 )
@@ -24,38 +24,28 @@ const (
 )
 
 var (
-	memoCmd     = []string{"!memo", "!m"}      // Slice containing the possible memo commands
-	memostatCmd = []string{"!memostat", "!ms"} // Slice containing the possible memo status commands
-	dbPtr       *sql.DB                        // Database pointer
+	memoCmd      = []string{"!memo", "!m"}      // Slice containing the possible memo commands
+	memostatCmd  = []string{"!memostat", "!ms"} // Slice containing the possible memo status commands
+	messageStore store.MessageStore             // Backing store for memos
 )
 
-// data stores memo informations, based on the database table "Memo".
-type data struct {
-	id       int
-	date     string
-	message  string
-	userFrom string
-	userTo   string
+// Init stores the MessageStore used to persist memos.
+func Init(s store.MessageStore) {
+	messageStore = s
 }
 
-// Init stores the database pointer and initialises the database table "Memo" if necessary.
-func Init(db *sql.DB) {
-	dbPtr = db
-	sqlStmt := `CREATE TABLE IF NOT EXISTS Memo (
-    id integer NOT NULL PRIMARY KEY,
-    user_to TEXT,
-    user_from TEXT,
-    message TEXT,
-    date DATETIME DEFAULT CURRENT_TIMESTAMP);`
-
-	_, err := db.Exec(sqlStmt)
-	if err != nil {
-		log.Fatalf("%q: %s\n", err, sqlStmt)
+// identity returns the caller's authenticated account when one was provided (via the
+// account-tag/SASL), falling back to core.ResolveIdentity otherwise, so memos survive a nick
+// change.
+func identity(nick string, tags core.MessageTags) string {
+	if tags.Account != "" {
+		return tags.Account
 	}
+	return core.ResolveIdentity(nick)
 }
 
 // HandleMemoCmd handles memo commands.
-func HandleMemoCmd(event *irc.Event, callback func(*core.ReplyCallbackData)) bool {
+func HandleMemoCmd(event *irc.Event, tags core.MessageTags, callback func(*core.ReplyCallbackData)) bool {
 	fields := strings.Fields(event.Message())
 	// fields[0]  => Command
 	// fields[1]  => recipient's nick
@@ -63,82 +53,66 @@ func HandleMemoCmd(event *irc.Event, callback func(*core.ReplyCallbackData)) boo
 	if len(fields) < 3 || !helpers.StringInSlice(fields[0], memoCmd) {
 		return false
 	}
-	memo := data{
-		userTo:   fields[1],
-		userFrom: event.Nick,
-		message:  strings.Join(fields[2:], " ")}
+	userTo := core.ResolveIdentity(fields[1])
+	userFrom := identity(event.Nick, tags)
+	message := strings.Join(fields[2:], " ")
+	network := core.GetNetworkFromEvent(event)
 
-	sqlStmt := "INSERT INTO Memo (user_to, user_from, message) VALUES ($1, $2, $3)"
-	_, err := dbPtr.Exec(sqlStmt, memo.userTo, memo.userFrom, memo.message)
-	if err != nil {
-		log.Fatalf("%q: %s\n", err, sqlStmt)
+	if err := messageStore.AddMemo(network, userTo, userFrom, message); err != nil {
+		log.Fatalf("Unable to save memo: %s\n", err)
 	}
 
 	if callback != nil {
 		callback(&core.ReplyCallbackData{
-			Message: fmt.Sprintf("%s: memo for %s saved", memo.userFrom, memo.userTo),
-			Nick:    memo.userFrom})
+			Message: fmt.Sprintf("%s: memo for %s saved", userFrom, userTo),
+			Target:  core.GetTargetFromEvent(event),
+			Network: network})
 	}
 	return true
 }
 
 // SendMemo is a message handler that will send memo(s) to an user when he post a message for the first time after a memo for him was created.
-func SendMemo(event *irc.Event, callback func(*core.ReplyCallbackData)) {
-	user := event.Nick
-	sqlQuery := "SELECT id, user_from, message, strftime('%d/%m/%Y @ %H:%M', datetime(date, 'localtime')) FROM Memo WHERE user_to = $1;"
-	rows, err := dbPtr.Query(sqlQuery, user)
+func SendMemo(event *irc.Event, tags core.MessageTags, callback func(*core.ReplyCallbackData)) {
+	userTo := identity(event.Nick, tags)
+	network := core.GetNetworkFromEvent(event)
+	memos, err := messageStore.PopMemos(network, userTo)
 	if err != nil {
-		log.Fatalf("%q: %s\n", err, sqlQuery)
+		log.Fatalf("Unable to retrieve memos: %s\n", err)
 	}
-	defer rows.Close()
 
-	userTo := event.Nick
-	var memoList []data
-	for rows.Next() {
-		var memo data
-		rows.Scan(&memo.id, &memo.userFrom, &memo.message, &memo.date)
-		memoList = append(memoList, memo)
+	target := core.GetTargetFromEvent(event)
+	for _, memo := range memos {
 		callback(&core.ReplyCallbackData{
-			Message: fmt.Sprintf("%s: memo from %s => \"%s\" (%s)", userTo, memo.userFrom, memo.message, memo.date),
-			Nick:    userTo})
-	}
-	rows.Close()
-
-	for _, memo := range memoList {
-		sqlQuery = "DELETE FROM Memo WHERE id = $1"
-		_, err = dbPtr.Exec(sqlQuery, memo.id)
-		if err != nil {
-			log.Fatalf("%q: %s\n", err, sqlQuery)
-		}
+			Message: fmt.Sprintf("%s: memo from %s => \"%s\" (%s)", userTo, memo.UserFrom, memo.Message, memo.Date.Format("02/01/2006 @ 15:04")),
+			Target:  target,
+			Network: network})
 	}
 }
 
 // HandleMemoStatusCmd handles memo status commands.
-func HandleMemoStatusCmd(event *irc.Event, callback func(*core.ReplyCallbackData)) bool {
+func HandleMemoStatusCmd(event *irc.Event, tags core.MessageTags, callback func(*core.ReplyCallbackData)) bool {
 	fields := strings.Fields(event.Message())
 	// fields[0]  => Command
 	if len(fields) == 0 || !helpers.StringInSlice(fields[0], memostatCmd) {
 		return false
 	}
 
-	sqlQuery := "SELECT id, user_to, message, strftime('%d/%m/%Y @ %H:%M', datetime(date, 'localtime')) FROM Memo WHERE user_from = $1 ORDER BY id"
-	rows, err := dbPtr.Query(sqlQuery, event.Nick)
+	network := core.GetNetworkFromEvent(event)
+	memos, err := messageStore.ListMemos(network, identity(event.Nick, tags))
 	if err != nil {
-		log.Fatalf("%q: %s\n", err, sqlQuery)
+		log.Fatalf("Unable to retrieve memos: %s\n", err)
 	}
-	defer rows.Close()
 
-	var memo data
-	for rows.Next() {
-		rows.Scan(&memo.id, &memo.userTo, &memo.message, &memo.date)
+	target := core.GetTargetFromEvent(event)
+	for _, memo := range memos {
 		callback(&core.ReplyCallbackData{
-			Message: fmt.Sprintf("Memo for %s: \"%s\" (%s)", memo.userTo, memo.message, memo.date),
-			Nick:    event.Nick})
+			Message: fmt.Sprintf("Memo for %s: \"%s\" (%s)", memo.UserTo, memo.Message, memo.Date.Format("02/01/2006 @ 15:04")),
+			Target:  target,
+			Network: network})
 	}
-	rows.Close()
 
-	if memo.id == 0 {
-		callback(&core.ReplyCallbackData{Message: "No memo saved", Nick: event.Nick})
+	if len(memos) == 0 {
+		callback(&core.ReplyCallbackData{Message: "No memo saved", Target: target, Network: network})
 	}
 	return true
 }
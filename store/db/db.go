@@ -0,0 +1,198 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2015 Arnaud Vazard
+//
+// See LICENSE file.
+
+// Package db is a store.MessageStore driver backed by the *sql.DB already used
+// by the rest of goxxx (SQLite in practice, but any database/sql driver works).
+package db
+
+import (
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/romainletendart/goxxx/store"
+)
+
+// Store is a store.MessageStore implementation persisting memos and channel
+// logs in a SQL database.
+type Store struct {
+	db *sql.DB
+}
+
+// New wraps db, creating the Memo, Message and MessageTarget tables if they do not exist yet.
+func New(db *sql.DB) *Store {
+	s := &Store{db: db}
+
+	statements := []string{
+		`CREATE TABLE IF NOT EXISTS Memo (
+		    id integer NOT NULL PRIMARY KEY,
+		    network TEXT NOT NULL DEFAULT '',
+		    user_to TEXT,
+		    user_from TEXT,
+		    message TEXT,
+		    date DATETIME DEFAULT CURRENT_TIMESTAMP);`,
+
+		`CREATE TABLE IF NOT EXISTS MessageTarget (
+		    network TEXT NOT NULL DEFAULT '',
+		    target TEXT NOT NULL,
+		    PRIMARY KEY (network, target));`,
+
+		`CREATE TABLE IF NOT EXISTS Message (
+		    id integer NOT NULL PRIMARY KEY,
+		    network TEXT NOT NULL DEFAULT '',
+		    target TEXT NOT NULL,
+		    nick TEXT NOT NULL,
+		    text TEXT,
+		    date DATETIME DEFAULT CURRENT_TIMESTAMP);`,
+
+		`CREATE INDEX IF NOT EXISTS message_target_date ON Message (network, target, date);`,
+	}
+	for _, sqlStmt := range statements {
+		if _, err := db.Exec(sqlStmt); err != nil {
+			log.Fatalf("%q: %s\n", err, sqlStmt)
+		}
+	}
+	return s
+}
+
+func (s *Store) AddMemo(network, userTo, userFrom, message string) error {
+	sqlStmt := "INSERT INTO Memo (network, user_to, user_from, message) VALUES ($1, $2, $3, $4)"
+	_, err := s.db.Exec(sqlStmt, network, userTo, userFrom, message)
+	return err
+}
+
+func (s *Store) PopMemos(network, userTo string) ([]store.Memo, error) {
+	memos, err := s.queryMemos("SELECT id, user_from, message, date FROM Memo WHERE network = $1 AND user_to = $2", network, userTo, false)
+	if err != nil {
+		return nil, err
+	}
+	for _, memo := range memos {
+		if _, err := s.db.Exec("DELETE FROM Memo WHERE id = $1", memo.ID); err != nil {
+			return memos, err
+		}
+	}
+	return memos, nil
+}
+
+func (s *Store) ListMemos(network, userFrom string) ([]store.Memo, error) {
+	return s.queryMemos("SELECT id, user_to, message, date FROM Memo WHERE network = $1 AND user_from = $2 ORDER BY id", network, userFrom, true)
+}
+
+// queryMemos runs sqlQuery (selecting id, the other nick, message and date, in that column order)
+// against network/nick and returns the matching memos. nickIsFrom says which side of the memo
+// nick is on, since PopMemos queries by user_to while ListMemos queries by user_from.
+func (s *Store) queryMemos(sqlQuery, network, nick string, nickIsFrom bool) ([]store.Memo, error) {
+	rows, err := s.db.Query(sqlQuery, network, nick)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var memos []store.Memo
+	for rows.Next() {
+		var memo store.Memo
+		var otherNick string
+		if err := rows.Scan(&memo.ID, &otherNick, &memo.Message, &memo.Date); err != nil {
+			return nil, err
+		}
+		memo.Date = memo.Date.Local()
+		memo.Network = network
+		if nickIsFrom {
+			memo.UserFrom, memo.UserTo = nick, otherNick
+		} else {
+			memo.UserFrom, memo.UserTo = otherNick, nick
+		}
+		memos = append(memos, memo)
+	}
+	return memos, rows.Err()
+}
+
+// ImportMessage inserts message as-is, preserving its original network/date instead of
+// stamping it with the current network/time. Meant for contrib/migrate-logs, not for live
+// log capture.
+func (s *Store) ImportMessage(message store.Message) error {
+	if _, err := s.db.Exec("INSERT OR IGNORE INTO MessageTarget (network, target) VALUES ($1, $2)", message.Network, message.Target); err != nil {
+		return err
+	}
+	_, err := s.db.Exec("INSERT INTO Message (network, target, nick, text, date) VALUES ($1, $2, $3, $4, $5)",
+		message.Network, message.Target, message.Nick, message.Text, message.Date)
+	return err
+}
+
+func (s *Store) LogMessage(network, target, nick, text string) error {
+	if _, err := s.db.Exec("INSERT OR IGNORE INTO MessageTarget (network, target) VALUES ($1, $2)", network, target); err != nil {
+		return err
+	}
+	_, err := s.db.Exec("INSERT INTO Message (network, target, nick, text) VALUES ($1, $2, $3, $4)", network, target, nick, text)
+	return err
+}
+
+func (s *Store) SearchMessages(network, target, query string, limit int) ([]store.Message, error) {
+	sqlQuery := "SELECT id, network, target, nick, text, date FROM Message WHERE network = $1 AND target = $2 AND text LIKE $3 ORDER BY id DESC LIMIT $4"
+	return s.queryMessages(sqlQuery, network, target, "%"+query+"%", normalizeLimit(limit))
+}
+
+func (s *Store) MessagesBefore(network, target string, msgID int64, limit int) ([]store.Message, error) {
+	sqlQuery := "SELECT id, network, target, nick, text, date FROM Message WHERE network = $1 AND target = $2 AND id < $3 ORDER BY id DESC LIMIT $4"
+	return s.queryMessages(sqlQuery, network, target, msgID, normalizeLimit(limit))
+}
+
+func (s *Store) MessagesAfter(network, target string, since time.Time, limit int) ([]store.Message, error) {
+	sqlQuery := "SELECT id, network, target, nick, text, date FROM Message WHERE network = $1 AND target = $2 AND date > $3 ORDER BY id ASC LIMIT $4"
+	return s.queryMessages(sqlQuery, network, target, since, normalizeLimit(limit))
+}
+
+func (s *Store) LatestMessages(network, target string, limit int) ([]store.Message, error) {
+	sqlQuery := "SELECT id, network, target, nick, text, date FROM Message WHERE network = $1 AND target = $2 ORDER BY id DESC LIMIT $3"
+	return s.queryMessages(sqlQuery, network, target, normalizeLimit(limit))
+}
+
+func (s *Store) Targets() ([]store.NetworkTarget, error) {
+	rows, err := s.db.Query("SELECT DISTINCT network, target FROM MessageTarget")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var targets []store.NetworkTarget
+	for rows.Next() {
+		var target store.NetworkTarget
+		if err := rows.Scan(&target.Network, &target.Target); err != nil {
+			return nil, err
+		}
+		targets = append(targets, target)
+	}
+	return targets, rows.Err()
+}
+
+// queryMessages runs sqlQuery (selecting id, network, target, nick, text, date, in that column
+// order) and returns the matching messages.
+func (s *Store) queryMessages(sqlQuery string, args ...interface{}) ([]store.Message, error) {
+	rows, err := s.db.Query(sqlQuery, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []store.Message
+	for rows.Next() {
+		var message store.Message
+		if err := rows.Scan(&message.ID, &message.Network, &message.Target, &message.Nick, &message.Text, &message.Date); err != nil {
+			return nil, err
+		}
+		message.Date = message.Date.Local()
+		messages = append(messages, message)
+	}
+	return messages, rows.Err()
+}
+
+// normalizeLimit turns a non-positive limit into a large-but-bounded one, since SQLite's LIMIT requires a value.
+func normalizeLimit(limit int) int {
+	if limit <= 0 {
+		return 1000
+	}
+	return limit
+}
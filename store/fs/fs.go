@@ -0,0 +1,307 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2015 Arnaud Vazard
+//
+// See LICENSE file.
+
+// Package fs is a store.MessageStore driver persisting channel logs as one
+// file per target (like soju's fs log backend) and memos as a single JSON
+// file, under a root directory.
+package fs
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/romainletendart/goxxx/store"
+)
+
+const timeLayout = "2006-01-02T15:04:05.000Z07:00"
+
+// Store is a store.MessageStore implementation persisting to plain files under root.
+type Store struct {
+	root  string
+	mutex sync.Mutex
+}
+
+// New creates a store rooted at root, creating the directory if necessary.
+func New(root string) (*Store, error) {
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, err
+	}
+	return &Store{root: root}, nil
+}
+
+func (s *Store) memosPath() string {
+	return filepath.Join(s.root, "memos.json")
+}
+
+// targetFileSep separates the escaped network and target halves of a log file name. QueryEscape
+// never emits "!" unescaped, so splitting on it is unambiguous even if network or target itself
+// contains an underscore or other unreserved character.
+const targetFileSep = "!"
+
+// targetPath returns the log file for target on network, escaping both so the result is safe
+// to use as a file name (and so the same target name on two networks does not collide).
+func (s *Store) targetPath(network, target string) string {
+	name := url.QueryEscape(network) + targetFileSep + url.QueryEscape(target) + ".log"
+	return filepath.Join(s.root, name)
+}
+
+func (s *Store) AddMemo(network, userTo, userFrom, message string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	memos, err := s.readMemos()
+	if err != nil {
+		return err
+	}
+	var nextID int64
+	for _, memo := range memos {
+		if memo.ID >= nextID {
+			nextID = memo.ID + 1
+		}
+	}
+	memos = append(memos, store.Memo{ID: nextID, Network: network, UserTo: userTo, UserFrom: userFrom, Message: message, Date: time.Now()})
+	return s.writeMemos(memos)
+}
+
+func (s *Store) PopMemos(network, userTo string) ([]store.Memo, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	memos, err := s.readMemos()
+	if err != nil {
+		return nil, err
+	}
+
+	var popped, remaining []store.Memo
+	for _, memo := range memos {
+		if memo.Network == network && memo.UserTo == userTo {
+			popped = append(popped, memo)
+		} else {
+			remaining = append(remaining, memo)
+		}
+	}
+	return popped, s.writeMemos(remaining)
+}
+
+func (s *Store) ListMemos(network, userFrom string) ([]store.Memo, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	memos, err := s.readMemos()
+	if err != nil {
+		return nil, err
+	}
+	var result []store.Memo
+	for _, memo := range memos {
+		if memo.Network == network && memo.UserFrom == userFrom {
+			result = append(result, memo)
+		}
+	}
+	return result, nil
+}
+
+func (s *Store) readMemos() ([]store.Memo, error) {
+	data, err := ioutil.ReadFile(s.memosPath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var memos []store.Memo
+	if err := json.Unmarshal(data, &memos); err != nil {
+		return nil, err
+	}
+	return memos, nil
+}
+
+func (s *Store) writeMemos(memos []store.Memo) error {
+	data, err := json.Marshal(memos)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(s.memosPath(), data, 0644)
+}
+
+// LogMessage appends a single tab-separated line ("id\tdate\tnick\ttext") to the
+// (network, target) pair's log file.
+func (s *Store) LogMessage(network, target, nick, text string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	existing, err := s.readMessages(network, target)
+	if err != nil {
+		return err
+	}
+	var nextID int64
+	for _, message := range existing {
+		if message.ID >= nextID {
+			nextID = message.ID + 1
+		}
+	}
+
+	file, err := os.OpenFile(s.targetPath(network, target), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	line := fmt.Sprintf("%d\t%s\t%s\t%s\n", nextID, time.Now().Format(timeLayout), nick, strings.Replace(text, "\n", " ", -1))
+	_, err = file.WriteString(line)
+	return err
+}
+
+// readMessages reads and parses the full log file for (network, target), oldest first.
+func (s *Store) readMessages(network, target string) ([]store.Message, error) {
+	file, err := os.Open(s.targetPath(network, target))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var messages []store.Message
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.SplitN(scanner.Text(), "\t", 4)
+		if len(fields) != 4 {
+			continue
+		}
+		id, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		date, err := time.Parse(timeLayout, fields[1])
+		if err != nil {
+			continue
+		}
+		messages = append(messages, store.Message{ID: id, Network: network, Target: target, Nick: fields[2], Text: fields[3], Date: date})
+	}
+	return messages, scanner.Err()
+}
+
+func (s *Store) SearchMessages(network, target, query string, limit int) ([]store.Message, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	messages, err := s.readMessages(network, target)
+	if err != nil {
+		return nil, err
+	}
+	var results []store.Message
+	query = strings.ToLower(query)
+	for i := len(messages) - 1; i >= 0; i-- {
+		if strings.Contains(strings.ToLower(messages[i].Text), query) {
+			results = append(results, messages[i])
+			if limit > 0 && len(results) >= limit {
+				break
+			}
+		}
+	}
+	return results, nil
+}
+
+func (s *Store) MessagesBefore(network, target string, msgID int64, limit int) ([]store.Message, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	messages, err := s.readMessages(network, target)
+	if err != nil {
+		return nil, err
+	}
+	var results []store.Message
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].ID >= msgID {
+			continue
+		}
+		results = append(results, messages[i])
+		if limit > 0 && len(results) >= limit {
+			break
+		}
+	}
+	return results, nil
+}
+
+func (s *Store) MessagesAfter(network, target string, since time.Time, limit int) ([]store.Message, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	messages, err := s.readMessages(network, target)
+	if err != nil {
+		return nil, err
+	}
+	var results []store.Message
+	for _, message := range messages {
+		if !message.Date.After(since) {
+			continue
+		}
+		results = append(results, message)
+		if limit > 0 && len(results) >= limit {
+			break
+		}
+	}
+	return results, nil
+}
+
+func (s *Store) LatestMessages(network, target string, limit int) ([]store.Message, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	messages, err := s.readMessages(network, target)
+	if err != nil {
+		return nil, err
+	}
+	var results []store.Message
+	for i := len(messages) - 1; i >= 0; i-- {
+		results = append(results, messages[i])
+		if limit > 0 && len(results) >= limit {
+			break
+		}
+	}
+	return results, nil
+}
+
+// Targets lists every (network, target) pair with a log file under root, derived from the
+// directory listing rather than a separate index (the fs driver has no O(1) index, unlike db).
+func (s *Store) Targets() ([]store.NetworkTarget, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	entries, err := ioutil.ReadDir(s.root)
+	if err != nil {
+		return nil, err
+	}
+	var targets []store.NetworkTarget
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasSuffix(name, ".log") {
+			continue
+		}
+		halves := strings.SplitN(strings.TrimSuffix(name, ".log"), targetFileSep, 2)
+		if len(halves) != 2 {
+			continue
+		}
+		network, err := url.QueryUnescape(halves[0])
+		if err != nil {
+			continue
+		}
+		target, err := url.QueryUnescape(halves[1])
+		if err != nil {
+			continue
+		}
+		targets = append(targets, store.NetworkTarget{Network: network, Target: target})
+	}
+	return targets, nil
+}
@@ -0,0 +1,166 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2015 Arnaud Vazard
+//
+// See LICENSE file.
+
+// Package memory is an in-memory store.MessageStore driver, mainly useful for tests.
+package memory
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/romainletendart/goxxx/store"
+)
+
+// messageKey scopes logged messages by (network, target), so the same channel name on two
+// networks (e.g. "#general" on both) does not collide.
+type messageKey struct {
+	network string
+	target  string
+}
+
+// Store is an in-memory, concurrency-safe implementation of store.MessageStore.
+// Nothing is persisted across restarts.
+type Store struct {
+	mutex    sync.RWMutex
+	nextMemo int64
+	nextMsg  int64
+	memos    []store.Memo
+	messages map[messageKey][]store.Message
+	targets  []store.NetworkTarget
+}
+
+// New creates an empty in-memory store.
+func New() *Store {
+	return &Store{messages: make(map[messageKey][]store.Message)}
+}
+
+func (s *Store) AddMemo(network, userTo, userFrom, message string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.nextMemo++
+	s.memos = append(s.memos, store.Memo{ID: s.nextMemo, Network: network, UserTo: userTo, UserFrom: userFrom, Message: message, Date: time.Now()})
+	return nil
+}
+
+func (s *Store) PopMemos(network, userTo string) ([]store.Memo, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var popped, remaining []store.Memo
+	for _, memo := range s.memos {
+		if memo.Network == network && memo.UserTo == userTo {
+			popped = append(popped, memo)
+		} else {
+			remaining = append(remaining, memo)
+		}
+	}
+	s.memos = remaining
+	return popped, nil
+}
+
+func (s *Store) ListMemos(network, userFrom string) ([]store.Memo, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	var memos []store.Memo
+	for _, memo := range s.memos {
+		if memo.Network == network && memo.UserFrom == userFrom {
+			memos = append(memos, memo)
+		}
+	}
+	return memos, nil
+}
+
+func (s *Store) LogMessage(network, target, nick, text string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	key := messageKey{network: network, target: target}
+	if _, present := s.messages[key]; !present {
+		s.targets = append(s.targets, store.NetworkTarget{Network: network, Target: target})
+	}
+	s.nextMsg++
+	s.messages[key] = append(s.messages[key], store.Message{ID: s.nextMsg, Network: network, Target: target, Nick: nick, Text: text, Date: time.Now()})
+	return nil
+}
+
+func (s *Store) SearchMessages(network, target, query string, limit int) ([]store.Message, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	var results []store.Message
+	query = strings.ToLower(query)
+	messages := s.messages[messageKey{network: network, target: target}]
+	for i := len(messages) - 1; i >= 0; i-- {
+		if strings.Contains(strings.ToLower(messages[i].Text), query) {
+			results = append(results, messages[i])
+			if limit > 0 && len(results) >= limit {
+				break
+			}
+		}
+	}
+	return results, nil
+}
+
+func (s *Store) MessagesBefore(network, target string, msgID int64, limit int) ([]store.Message, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	var results []store.Message
+	messages := s.messages[messageKey{network: network, target: target}]
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].ID >= msgID {
+			continue
+		}
+		results = append(results, messages[i])
+		if limit > 0 && len(results) >= limit {
+			break
+		}
+	}
+	return results, nil
+}
+
+func (s *Store) MessagesAfter(network, target string, since time.Time, limit int) ([]store.Message, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	var results []store.Message
+	for _, message := range s.messages[messageKey{network: network, target: target}] {
+		if !message.Date.After(since) {
+			continue
+		}
+		results = append(results, message)
+		if limit > 0 && len(results) >= limit {
+			break
+		}
+	}
+	return results, nil
+}
+
+func (s *Store) LatestMessages(network, target string, limit int) ([]store.Message, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	messages := s.messages[messageKey{network: network, target: target}]
+	var results []store.Message
+	for i := len(messages) - 1; i >= 0; i-- {
+		results = append(results, messages[i])
+		if limit > 0 && len(results) >= limit {
+			break
+		}
+	}
+	return results, nil
+}
+
+func (s *Store) Targets() ([]store.NetworkTarget, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	targets := make([]store.NetworkTarget, len(s.targets))
+	copy(targets, s.targets)
+	return targets, nil
+}
@@ -0,0 +1,66 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2015 Arnaud Vazard
+//
+// See LICENSE file.
+
+// Package store defines MessageStore, the persistence interface shared by the
+// memo feature and channel log capture/search, along with the drivers
+// implementing it (memory, fs, db).
+package store
+
+import "time"
+
+// Memo is a message left for a target user, delivered the next time that user speaks.
+// Network scopes UserTo/UserFrom so the same nick on two networks does not collide.
+type Memo struct {
+	ID       int64
+	Network  string
+	UserTo   string
+	UserFrom string
+	Message  string
+	Date     time.Time
+}
+
+// Message is a single logged channel/nick message. Network scopes Target so the same
+// channel name on two networks (e.g. "#general" on both) does not collide.
+type Message struct {
+	ID      int64
+	Network string
+	Target  string // Channel or nick the message was sent to
+	Nick    string // Author of the message
+	Text    string
+	Date    time.Time
+}
+
+// MessageStore is implemented by every storage driver (memory, fs, db).
+// It backs both the memo feature and channel log capture/search.
+type MessageStore interface {
+	// AddMemo stores a new memo for userTo, left by userFrom on network.
+	AddMemo(network, userTo, userFrom, message string) error
+	// PopMemos returns and deletes every pending memo left for userTo on network.
+	PopMemos(network, userTo string) ([]Memo, error)
+	// ListMemos returns every pending memo left by userFrom on network, without deleting them.
+	ListMemos(network, userFrom string) ([]Memo, error)
+
+	// LogMessage persists a single message posted to target on network.
+	LogMessage(network, target, nick, text string) error
+	// SearchMessages returns up to limit messages sent to target on network whose text matches query.
+	SearchMessages(network, target, query string, limit int) ([]Message, error)
+	// MessagesBefore returns up to limit messages sent to target on network before msgID, most recent first.
+	MessagesBefore(network, target string, msgID int64, limit int) ([]Message, error)
+	// MessagesAfter returns up to limit messages sent to target on network after since, oldest first.
+	MessagesAfter(network, target string, since time.Time, limit int) ([]Message, error)
+	// LatestMessages returns up to limit of the most recent messages sent to target on network, most recent first.
+	LatestMessages(network, target string, limit int) ([]Message, error)
+	// Targets lists every (network, target) pair known to the store (O(1) enumeration for
+	// drivers that maintain an index).
+	Targets() ([]NetworkTarget, error)
+}
+
+// NetworkTarget identifies a single target (channel or nick) on a single network, as returned
+// by MessageStore.Targets.
+type NetworkTarget struct {
+	Network string
+	Target  string
+}